@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/meltwater/drone-s3-cache/encryption"
+)
+
+// joinRepo builds an object key by joining repo-relative segments with "/",
+// regardless of the host OS path separator.
+func joinRepo(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Upload tars the contents of src and streams the archive to path in the
+// given Provider. If enc is non-nil, the archive is encrypted client-side
+// before it is handed to the Provider.
+func Upload(p Provider, enc encryption.Encryptor, src, path string) error {
+	r, w := io.Pipe()
+
+	errCh := make(chan error, 1)
+	go func() {
+		defer w.Close()
+		errCh <- tarDirectory(src, w)
+	}()
+
+	var body io.Reader = r
+	if enc != nil {
+		encrypted, err := enc.Encrypt(r)
+		if err != nil {
+			return errors.Wrap(err, "could not encrypt archive")
+		}
+		body = encrypted
+	}
+
+	if err := p.Put(path, body); err != nil {
+		return err
+	}
+	return <-errCh
+}
+
+// Download restores the archive stored at path in the given Provider into
+// dst, decrypting it first if enc is non-nil.
+func Download(p Provider, enc encryption.Encryptor, path, dst string) error {
+	rc, err := p.Get(path)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var body io.Reader = rc
+	if enc != nil {
+		decrypted, err := enc.Decrypt(rc)
+		if err != nil {
+			return errors.Wrap(err, "could not decrypt archive")
+		}
+		body = decrypted
+	}
+
+	return untarDirectory(body, dst)
+}
+
+// tarDirectory walks src and writes a tar archive of its contents to w.
+func tarDirectory(src string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	return filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, info.Name())
+		if err != nil {
+			return errors.Wrap(err, "could not build tar header")
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return errors.Wrap(err, "could not resolve relative path")
+		}
+		header.Name = rel
+
+		if err := tw.WriteHeader(header); err != nil {
+			return errors.Wrap(err, "could not write tar header")
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return errors.Wrap(err, "could not open file")
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return errors.Wrap(err, "could not write file contents")
+	})
+}
+
+// untarDirectory extracts the tar archive read from r into dst.
+func untarDirectory(r io.Reader, dst string) error {
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "could not read tar header")
+		}
+
+		target := filepath.Join(dst, header.Name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(header.Mode)); err != nil {
+				return errors.Wrap(err, "could not create directory")
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return errors.Wrap(err, "could not create parent directory")
+			}
+
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode))
+			if err != nil {
+				return errors.Wrap(err, "could not create file")
+			}
+
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return errors.Wrap(err, "could not write file contents")
+			}
+			f.Close()
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/meltwater/drone-s3-cache/chunker"
+	"github.com/meltwater/drone-s3-cache/encryption"
+)
+
+const chunkPrefix = "sha256"
+
+// ChunkConfig controls the content-addressable chunking pipeline.
+type ChunkConfig struct {
+	chunker.Params
+	// CompressionLevel is passed to the zstd encoder; zero picks the
+	// library default.
+	CompressionLevel int
+	// PackSize, if positive, batches every chunk into pack files of
+	// roughly this many bytes instead of storing each as its own object.
+	// Zero disables packing and every chunk is stored individually.
+	PackSize int
+	// Concurrency bounds how many chunk uploads run at once. Only applies
+	// when PackSize is 0: packing serializes writes into a shared buffer,
+	// so it can't be fanned out the same way. One if unset.
+	Concurrency int
+}
+
+// UploadChunked splits every file under src into content-defined chunks,
+// uploads any chunk not already present under sha256/<hex> (or into a pack),
+// and writes a small JSON snapshot describing how to reassemble src. If enc
+// is non-nil, each chunk is encrypted client-side before it is stored. It
+// returns the number of bytes actually written to the backend this run —
+// typically far less than src's size, since chunks already present from an
+// earlier run are deduplicated rather than re-uploaded.
+func UploadChunked(p Provider, cfg ChunkConfig, enc encryption.Encryptor, src, snapshotPath string) (int64, error) {
+	var pw *packWriter
+	if cfg.PackSize > 0 {
+		var err error
+		pw, err = newPackWriter(p, filepath.Dir(snapshotPath), cfg.PackSize)
+		if err != nil {
+			return 0, errors.Wrap(err, "could not create pack writer")
+		}
+	}
+
+	snap := &Snapshot{}
+	var transferred int64
+
+	err := filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+
+		entry := FileEntry{Path: rel, Mode: uint32(info.Mode()), IsDir: info.IsDir(), Size: info.Size()}
+		if info.IsDir() {
+			snap.Files = append(snap.Files, entry)
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return errors.Wrap(err, "could not open file")
+		}
+		defer f.Close()
+
+		hashes, stored, err := chunkAndStore(p, cfg, enc, pw, filepath.Dir(snapshotPath), f)
+		if err != nil {
+			return errors.Wrapf(err, "could not chunk %s", rel)
+		}
+		entry.Chunks = hashes
+		transferred += stored
+
+		snap.Files = append(snap.Files, entry)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if pw != nil {
+		if err := pw.Close(); err != nil {
+			return 0, err
+		}
+		transferred += pw.BytesUploaded()
+	}
+
+	var buf bytes.Buffer
+	if err := snap.Encode(&buf); err != nil {
+		return 0, errors.Wrap(err, "could not encode snapshot")
+	}
+	transferred += int64(buf.Len())
+
+	if err := p.Put(snapshotPath, &buf); err != nil {
+		return 0, err
+	}
+	return transferred, nil
+}
+
+// chunkAndStore splits r into content-defined chunks, compresses (and
+// optionally encrypts) each one, and stores it — deduplicating against
+// what the backend already has — either as its own object or inside the
+// current pack. It returns the ordered list of plaintext chunk hashes and
+// the number of bytes actually uploaded for chunks stored individually
+// (packed bytes are reported separately via packWriter.BytesUploaded,
+// since packing batches several chunks into one upload).
+func chunkAndStore(p Provider, cfg ChunkConfig, enc encryption.Encryptor, pw *packWriter, repo string, r *os.File) ([]string, int64, error) {
+	c := chunker.New(r, cfg.Params)
+
+	zenc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(cfg.CompressionLevel)))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "could not create zstd encoder")
+	}
+	defer zenc.Close()
+
+	// Packing is stateful (chunks are appended to a shared buffer in order),
+	// so it can't be fanned out; uploads of individually-stored chunks can.
+	var group *errgroup.Group
+	var sem chan struct{}
+	if pw == nil {
+		group = new(errgroup.Group)
+		sem = make(chan struct{}, concurrencyOrDefault(cfg.Concurrency))
+	}
+
+	var hashes []string
+	var transferred int64
+	for {
+		chunk, err := c.Next()
+		if err != nil {
+			break
+		}
+
+		sum := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(sum[:])
+		hashes = append(hashes, hash)
+
+		compressed := zenc.EncodeAll(chunk, nil)
+
+		stored, err := sealChunk(enc, compressed)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "could not encrypt chunk %s", hash)
+		}
+
+		if pw != nil {
+			if err := pw.Add(hash, stored); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+
+		hash, stored := hash, stored
+		sem <- struct{}{}
+		group.Go(func() error {
+			defer func() { <-sem }()
+			n, err := storeChunk(p, repo, hash, stored)
+			atomic.AddInt64(&transferred, n)
+			return err
+		})
+	}
+
+	if group != nil {
+		if err := group.Wait(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return hashes, transferred, nil
+}
+
+// storeChunk uploads a single chunk's sealed bytes under sha256/<hash>,
+// skipping the upload if the backend already has it. It returns the number
+// of bytes actually uploaded (0 if the chunk was already present).
+func storeChunk(p Provider, repo, hash string, stored []byte) (int64, error) {
+	key := joinRepo(repo, chunkPrefix, hash)
+	exists, err := p.Exists(key)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not check chunk existence")
+	}
+	if exists {
+		return 0, nil
+	}
+	if err := p.Put(key, bytes.NewReader(stored)); err != nil {
+		return 0, errors.Wrap(err, "could not upload chunk")
+	}
+	return int64(len(stored)), nil
+}
+
+// concurrencyOrDefault returns n, or 1 (sequential) if n is zero or negative.
+func concurrencyOrDefault(n int) int {
+	if n <= 0 {
+		return 1
+	}
+	return n
+}
+
+// sealChunk encrypts a compressed chunk's bytes with enc, or returns them
+// unchanged if enc is nil.
+func sealChunk(enc encryption.Encryptor, compressed []byte) ([]byte, error) {
+	if enc == nil {
+		return compressed, nil
+	}
+
+	r, err := enc.Encrypt(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// openChunk decrypts a stored chunk's bytes with enc, or returns them
+// unchanged if enc is nil.
+func openChunk(enc encryption.Encryptor, stored []byte) ([]byte, error) {
+	if enc == nil {
+		return stored, nil
+	}
+
+	r, err := enc.Decrypt(bytes.NewReader(stored))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// readChunk fetches a chunk's stored bytes (compressed, and encrypted if an
+// Encryptor was used on upload), preferring a pack manifest
+// entry (avoiding a per-chunk request) and falling back to the chunk's own
+// sha256/<hex> object.
+func readChunk(p Provider, repo string, manifest packManifest, hash string) ([]byte, error) {
+	if loc, ok := manifest[hash]; ok {
+		return readPackBlob(p, repo, loc.Pack, packBlob{Hash: hash, Offset: loc.Offset, Length: loc.Length})
+	}
+
+	rc, err := p.Get(joinRepo(repo, chunkPrefix, hash))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+// DownloadChunked reads the snapshot at snapshotPath and restores every
+// file it describes into dst, fetching, decrypting (if enc is non-nil) and
+// decompressing each referenced chunk in turn.
+func DownloadChunked(p Provider, enc encryption.Encryptor, snapshotPath, dst string) error {
+	rc, err := p.Get(snapshotPath)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	snap, err := DecodeSnapshot(rc)
+	if err != nil {
+		return errors.Wrap(err, "could not decode snapshot")
+	}
+
+	repo := filepath.Dir(snapshotPath)
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return errors.Wrap(err, "could not create zstd decoder")
+	}
+	defer dec.Close()
+
+	manifest, err := loadPackManifest(p, repo)
+	if err != nil {
+		return errors.Wrap(err, "could not load pack manifest")
+	}
+
+	for _, entry := range snap.Files {
+		target := filepath.Join(dst, entry.Path)
+
+		if entry.IsDir {
+			if err := os.MkdirAll(target, os.FileMode(entry.Mode)); err != nil {
+				return errors.Wrap(err, "could not create directory")
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return errors.Wrap(err, "could not create parent directory")
+		}
+
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(entry.Mode))
+		if err != nil {
+			return errors.Wrap(err, "could not create file")
+		}
+
+		for _, hash := range entry.Chunks {
+			stored, err := readChunk(p, repo, manifest, hash)
+			if err != nil {
+				f.Close()
+				return errors.Wrapf(err, "could not read chunk %s", hash)
+			}
+
+			compressed, err := openChunk(enc, stored)
+			if err != nil {
+				f.Close()
+				return errors.Wrapf(err, "could not decrypt chunk %s", hash)
+			}
+
+			plain, err := dec.DecodeAll(compressed, nil)
+			if err != nil {
+				f.Close()
+				return errors.Wrapf(err, "could not decompress chunk %s", hash)
+			}
+
+			if _, err := f.Write(plain); err != nil {
+				f.Close()
+				return errors.Wrapf(err, "could not write chunk %s", hash)
+			}
+		}
+
+		f.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const packPrefix = "packs"
+
+// packBlob is the index entry for one chunk stored inside a pack file.
+type packBlob struct {
+	Hash   string `json:"hash"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+// packIndex lists every chunk contained in a single pack file, mirroring
+// restic's pack layout so many small chunks don't each cost a separate
+// request against the backend.
+type packIndex struct {
+	Blobs []packBlob `json:"blobs"`
+}
+
+// packLocation is where a chunk hash's packManifest entry points: the pack
+// file it lives in plus its offset and length within that file.
+type packLocation struct {
+	Pack   string `json:"pack"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+// packManifest maps a chunk hash to the pack file and offset it was stored
+// at, so a restore can locate it without downloading every pack index.
+type packManifest map[string]packLocation
+
+// legacyPackManifestPath is the single shared manifest key written by
+// earlier versions of packWriter. It is still read (and merged in) for
+// backwards compatibility, but never written to: concurrent mounts each
+// overwriting this one key raced and could silently drop each other's
+// entries. Every packWriter now writes its own manifest fragment instead.
+const legacyPackManifestPath = packPrefix + "/manifest.json"
+
+// packManifestFragmentPrefix namespaces one packWriter instance's manifest
+// fragment, so concurrently uploading mounts never contend on the same
+// object key. loadPackManifest merges every fragment (plus the legacy
+// manifest, if present) into a single view.
+const packManifestFragmentPrefix = packPrefix + "/manifest-"
+
+// packWriter batches chunks into pack files of roughly packSize bytes
+// before handing them to the Provider, to keep request counts down when a
+// cache entry is made up of many small chunks.
+type packWriter struct {
+	provider Provider
+	repo     string
+	packSize int
+	// id namespaces this writer's pack files and manifest fragment so two
+	// packWriters uploading concurrently (e.g. different mounts in the
+	// same repo/branch) never write to the same key.
+	id string
+
+	buf      bytes.Buffer
+	index    packIndex
+	manifest packManifest
+	added    packManifest
+	seq      int
+	uploaded int64
+}
+
+// BytesUploaded returns the number of bytes this writer has actually sent
+// to the backend so far: pack data, pack indexes and its manifest
+// fragment. Chunks skipped as already-referenced by the manifest don't
+// count, so this reflects real transfer, not the logical size packed.
+func (w *packWriter) BytesUploaded() int64 {
+	return w.uploaded
+}
+
+// newPackWriter loads the existing remote pack manifest (so chunks it
+// already covers can be deduplicated against) and returns a packWriter
+// that stores new chunks under its own namespaced pack files.
+func newPackWriter(p Provider, repo string, packSize int) (*packWriter, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not generate pack writer id")
+	}
+
+	manifest, err := loadPackManifest(p, repo)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load pack manifest")
+	}
+	if manifest == nil {
+		manifest = packManifest{}
+	}
+
+	return &packWriter{provider: p, repo: repo, packSize: packSize, id: id, manifest: manifest, added: packManifest{}}, nil
+}
+
+// Add appends a chunk to the current pack, flushing it first if the chunk
+// would push a non-empty pack past packSize. Chunks the remote manifest already references are
+// skipped entirely, the same deduplication the unpacked path gets from its
+// Exists check.
+func (w *packWriter) Add(hash string, data []byte) error {
+	if _, ok := w.manifest[hash]; ok {
+		return nil
+	}
+
+	if w.buf.Len() > 0 && w.buf.Len()+len(data) > w.packSize {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+
+	w.index.Blobs = append(w.index.Blobs, packBlob{
+		Hash:   hash,
+		Offset: int64(w.buf.Len()),
+		Length: int64(len(data)),
+	})
+	_, err := w.buf.Write(data)
+	return errors.Wrap(err, "could not buffer chunk")
+}
+
+// Close flushes any remaining buffered chunks and uploads this writer's
+// manifest fragment, tying every chunk hash it added back to its pack.
+func (w *packWriter) Close() error {
+	if w.buf.Len() > 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(w.added) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(w.added); err != nil {
+		return errors.Wrap(err, "could not encode pack manifest fragment")
+	}
+	w.uploaded += int64(buf.Len())
+	return w.provider.Put(joinRepo(w.repo, packManifestFragmentPrefix+w.id+".json"), &buf)
+}
+
+func (w *packWriter) flush() error {
+	w.seq++
+	id := fmt.Sprintf("%s/pack-%s-%04d", packPrefix, w.id, w.seq)
+
+	if err := w.provider.Put(joinRepo(w.repo, id), bytes.NewReader(w.buf.Bytes())); err != nil {
+		return errors.Wrap(err, "could not upload pack")
+	}
+	w.uploaded += int64(w.buf.Len())
+
+	var indexBuf bytes.Buffer
+	if err := json.NewEncoder(&indexBuf).Encode(w.index); err != nil {
+		return errors.Wrap(err, "could not encode pack index")
+	}
+	if err := w.provider.Put(joinRepo(w.repo, id+".index"), &indexBuf); err != nil {
+		return errors.Wrap(err, "could not upload pack index")
+	}
+	w.uploaded += int64(indexBuf.Len())
+
+	for _, blob := range w.index.Blobs {
+		loc := packLocation{Pack: id, Offset: blob.Offset, Length: blob.Length}
+		w.manifest[blob.Hash] = loc
+		w.added[blob.Hash] = loc
+	}
+
+	w.buf.Reset()
+	w.index = packIndex{}
+	return nil
+}
+
+// randomID returns a short random hex string used to namespace a
+// packWriter's objects.
+func randomID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// loadPackManifest merges every manifest fragment under repo (plus the
+// legacy single-file manifest, if one was left over from before fragments)
+// into one chunk hash -> pack location view. Returns an empty, non-nil
+// manifest if packing was never enabled for repo.
+func loadPackManifest(p Provider, repo string) (packManifest, error) {
+	manifest := packManifest{}
+
+	objects, err := p.List(joinRepo(repo, packPrefix) + "/")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list pack manifests")
+	}
+
+	for _, obj := range objects {
+		base := obj.Key[strings.LastIndex(obj.Key, "/")+1:]
+		if base != "manifest.json" && !strings.HasPrefix(base, "manifest-") {
+			continue
+		}
+
+		fragment, err := readPackManifestFile(p, obj.Key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read pack manifest %s", obj.Key)
+		}
+		for hash, loc := range fragment {
+			manifest[hash] = loc
+		}
+	}
+
+	return manifest, nil
+}
+
+func readPackManifestFile(p Provider, key string) (packManifest, error) {
+	rc, err := p.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	manifest := packManifest{}
+	if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// readPackBlob extracts a single chunk's bytes out of a pack file.
+func readPackBlob(p Provider, repo, packID string, blob packBlob) ([]byte, error) {
+	rc, err := p.Get(joinRepo(repo, packID))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get pack")
+	}
+	defer rc.Close()
+
+	if _, err := io.CopyN(ioutil.Discard, rc, blob.Offset); err != nil {
+		return nil, errors.Wrap(err, "could not seek to blob")
+	}
+
+	data := make([]byte, blob.Length)
+	if _, err := io.ReadFull(rc, data); err != nil {
+		return nil, errors.Wrap(err, "could not read blob")
+	}
+	return data, nil
+}
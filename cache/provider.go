@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"io"
+	"time"
+)
+
+// Object describes one entry returned by Provider.List or Provider.Stat.
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Provider abstracts a remote or local cache backend. Concrete
+// implementations live under the provider package, one per supported
+// storage system (S3, GCS, Azure Blob, MinIO, SFTP, filesystem, ...).
+type Provider interface {
+	// Get opens the object stored at path for reading. Callers must Close
+	// the returned reader.
+	Get(path string) (io.ReadCloser, error)
+	// Put streams contents to path, creating or overwriting the object.
+	Put(path string, contents io.Reader) error
+	// Exists reports whether an object already exists at path, typically
+	// via a HEAD request. Used to skip re-uploading content-addressed
+	// chunks that are already present.
+	Exists(path string) (bool, error)
+	// List enumerates every object whose key starts with prefix.
+	List(prefix string) ([]Object, error)
+	// Stat returns the size and last-modified time of the object at path.
+	Stat(path string) (Object, error)
+	// Delete removes the object at path.
+	Delete(path string) error
+}
@@ -0,0 +1,339 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PruneOptions bounds how much cache a single repo prefix is allowed to
+// retain.
+type PruneOptions struct {
+	// FlushAge removes any snapshot older than this. Zero disables
+	// age-based eviction.
+	FlushAge time.Duration
+	// MaxCacheSize evicts the least-recently-modified snapshots, once
+	// FlushAge has been applied, until the chunks and packs their
+	// survivors still reference fit under this many bytes. Zero disables
+	// size-based eviction.
+	MaxCacheSize int64
+	// KeepPerBranch retains only the N most recently modified snapshots
+	// per branch (the first path segment under repo), regardless of age
+	// or size, so feature branches don't accumulate forever. Zero
+	// disables this check.
+	KeepPerBranch int
+}
+
+// PruneResult summarizes what a Prune call removed.
+type PruneResult struct {
+	ObjectsRemoved int
+	BytesFreed     int64
+}
+
+// Prune enumerates every object under repo, decides which snapshots
+// (rebuild entries) to evict per opts, then garbage-collects the chunks
+// and pack files left unreferenced by whatever snapshots survive.
+//
+// chunk0-2's whole point is that one chunk backs many snapshots, so
+// eviction can't be a flat per-object mtime sweep: that would delete a
+// chunk a live snapshot still needs just because the chunk itself hasn't
+// been touched since it was first uploaded. Instead, FlushAge,
+// KeepPerBranch and MaxCacheSize are applied to snapshot objects only;
+// chunks and packs are then kept or deleted based on whether any
+// surviving snapshot still references them, restic-style.
+func Prune(p Provider, repo string, opts PruneOptions) (PruneResult, error) {
+	objects, err := p.List(repo)
+	if err != nil {
+		return PruneResult{}, errors.Wrap(err, "could not list cache objects")
+	}
+
+	snapshots, data := partitionObjects(repo, objects)
+
+	evicted := make(map[string]Object)
+
+	if opts.FlushAge > 0 {
+		cutoff := time.Now().Add(-opts.FlushAge)
+		for _, o := range snapshots {
+			if o.LastModified.Before(cutoff) {
+				evicted[o.Key] = o
+			}
+		}
+	}
+
+	if opts.KeepPerBranch > 0 {
+		byBranch := make(map[string][]Object)
+		for _, o := range snapshots {
+			if _, gone := evicted[o.Key]; gone {
+				continue
+			}
+			branch := branchOf(repo, o.Key)
+			byBranch[branch] = append(byBranch[branch], o)
+		}
+
+		for _, group := range byBranch {
+			sort.Slice(group, func(i, j int) bool {
+				return group[i].LastModified.After(group[j].LastModified)
+			})
+			for _, o := range group[min(opts.KeepPerBranch, len(group)):] {
+				evicted[o.Key] = o
+			}
+		}
+	}
+
+	surviving := remaining(snapshots, evicted)
+
+	if opts.MaxCacheSize > 0 {
+		surviving, err = evictUntilUnderBudget(p, repo, surviving, data, opts.MaxCacheSize)
+		if err != nil {
+			return PruneResult{}, err
+		}
+		survives := make(map[string]bool, len(surviving))
+		for _, o := range surviving {
+			survives[o.Key] = true
+		}
+		for _, o := range snapshots {
+			if !survives[o.Key] {
+				evicted[o.Key] = o
+			}
+		}
+	}
+
+	live, err := reachableData(p, repo, surviving)
+	if err != nil {
+		return PruneResult{}, errors.Wrap(err, "could not resolve reachable chunks")
+	}
+
+	for _, o := range data {
+		if isManifestObject(o.Key) || live[o.Key] {
+			continue
+		}
+		evicted[o.Key] = o
+	}
+
+	var result PruneResult
+	for key, o := range evicted {
+		if err := p.Delete(key); err != nil {
+			return result, errors.Wrapf(err, "could not delete %s", key)
+		}
+		result.ObjectsRemoved++
+		result.BytesFreed += o.Size
+	}
+
+	return result, nil
+}
+
+// partitionObjects splits every object under repo into snapshots (one per
+// rebuilt mount: Repo/Branch/<hash>) and data (content-addressed chunks and
+// pack files living under Repo/Branch/sha256/... or Repo/Branch/packs/...).
+func partitionObjects(repo string, objects []Object) (snapshots, data []Object) {
+	for _, o := range objects {
+		rel := strings.TrimPrefix(o.Key, repo+"/")
+		parts := strings.SplitN(rel, "/", 3)
+		if len(parts) == 3 && (parts[1] == chunkPrefix || parts[1] == packPrefix) {
+			data = append(data, o)
+			continue
+		}
+		snapshots = append(snapshots, o)
+	}
+	return snapshots, data
+}
+
+// remaining returns every snapshot not already marked evicted.
+func remaining(snapshots []Object, evicted map[string]Object) []Object {
+	var out []Object
+	for _, o := range snapshots {
+		if _, gone := evicted[o.Key]; !gone {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// evictUntilUnderBudget evicts the oldest surviving snapshots, one at a
+// time, until the data reachable from whatever snapshots remain fits under
+// maxSize. Chunks shared by several snapshots (the common case a few
+// commits apart) aren't double-counted, so this can keep far more
+// snapshots than a naive per-object size sweep would.
+//
+// Every snapshot still in the running is downloaded and decoded, and every
+// branch's pack manifest loaded, at most once: a reachableCache memoizes
+// both across iterations of the loop below, which otherwise re-fetched
+// every surviving snapshot and manifest from the backend on every single
+// eviction - O(N^2) round trips for N over-budget snapshots.
+func evictUntilUnderBudget(p Provider, repo string, surviving, data []Object, maxSize int64) ([]Object, error) {
+	ordered := append([]Object(nil), surviving...)
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].LastModified.Before(ordered[j].LastModified)
+	})
+
+	sizes := make(map[string]int64, len(data))
+	for _, o := range data {
+		sizes[o.Key] = o.Size
+	}
+
+	rc := newReachableCache(p, repo)
+
+	for len(ordered) > 0 {
+		live, err := rc.reachableData(ordered)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not resolve reachable chunks")
+		}
+
+		var total int64
+		for key := range live {
+			total += sizes[key]
+		}
+		for _, o := range ordered {
+			total += o.Size
+		}
+
+		if total <= maxSize {
+			break
+		}
+
+		ordered = ordered[1:]
+	}
+
+	return ordered, nil
+}
+
+// reachableData returns the set of data object keys (chunks, pack files and
+// pack indexes) referenced by surviving snapshots. Pack manifests are not
+// in the set; Prune keeps them regardless (see isManifestObject), since
+// they're tiny and trimming them requires rewriting rather than deleting.
+func reachableData(p Provider, repo string, surviving []Object) (map[string]bool, error) {
+	return newReachableCache(p, repo).reachableData(surviving)
+}
+
+// reachableCache memoizes the backend work reachableData needs - decoding a
+// snapshot object and loading a branch's pack manifest - so computing the
+// reachable set for several overlapping subsets of the same snapshots (as
+// evictUntilUnderBudget does, one snapshot fewer per iteration) only ever
+// fetches each snapshot and manifest once.
+type reachableCache struct {
+	p    Provider
+	repo string
+
+	snapshots map[string]*Snapshot
+	manifests map[string]packManifest
+}
+
+func newReachableCache(p Provider, repo string) *reachableCache {
+	return &reachableCache{
+		p:         p,
+		repo:      repo,
+		snapshots: make(map[string]*Snapshot),
+		manifests: make(map[string]packManifest),
+	}
+}
+
+func (rc *reachableCache) snapshot(key string) (*Snapshot, error) {
+	if snap, ok := rc.snapshots[key]; ok {
+		if snap == nil {
+			return nil, errors.Errorf("%s is not a chunked snapshot", key)
+		}
+		return snap, nil
+	}
+
+	snap, err := decodeSnapshotObject(rc.p, key)
+	if err != nil {
+		// Not a chunked-format snapshot (e.g. a plain tar archive) - it has
+		// no separate chunk/pack objects to protect. Cache the miss too, so
+		// a later call doesn't re-download it only to decode it again.
+		rc.snapshots[key] = nil
+		return nil, err
+	}
+	rc.snapshots[key] = snap
+	return snap, nil
+}
+
+func (rc *reachableCache) manifest(branchRepo string) (packManifest, error) {
+	if manifest, ok := rc.manifests[branchRepo]; ok {
+		return manifest, nil
+	}
+
+	manifest, err := loadPackManifest(rc.p, branchRepo)
+	if err != nil {
+		return nil, err
+	}
+	rc.manifests[branchRepo] = manifest
+	return manifest, nil
+}
+
+func (rc *reachableCache) reachableData(surviving []Object) (map[string]bool, error) {
+	live := make(map[string]bool)
+
+	for _, o := range surviving {
+		branch := branchOf(rc.repo, o.Key)
+		branchRepo := joinRepo(rc.repo, branch)
+
+		snap, err := rc.snapshot(o.Key)
+		if err != nil {
+			continue
+		}
+
+		manifest, err := rc.manifest(branchRepo)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range snap.Files {
+			for _, hash := range file.Chunks {
+				if loc, packed := manifest[hash]; packed {
+					live[joinRepo(branchRepo, loc.Pack)] = true
+					live[joinRepo(branchRepo, loc.Pack)+".index"] = true
+				} else {
+					live[joinRepo(branchRepo, chunkPrefix, hash)] = true
+				}
+			}
+		}
+	}
+
+	return live, nil
+}
+
+// decodeSnapshotObject downloads and decodes the chunked-format Snapshot
+// stored at key. It returns an error (and no snapshot) for any object that
+// isn't valid Snapshot JSON, e.g. a legacy tar-format cache entry.
+func decodeSnapshotObject(p Provider, key string) (*Snapshot, error) {
+	rc, err := p.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	contents, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecodeSnapshot(bytes.NewReader(contents))
+}
+
+// isManifestObject reports whether key is a pack manifest (the legacy
+// single-file manifest or one of a packWriter's namespaced fragments).
+// Manifests are always kept: they're tiny, and trimming stale entries out
+// of one would mean rewriting it rather than deleting it outright.
+func isManifestObject(key string) bool {
+	base := key[strings.LastIndex(key, "/")+1:]
+	return base == "manifest.json" || strings.HasPrefix(base, "manifest-")
+}
+
+// branchOf returns the first path segment of key below repo, which is
+// where cache keys store the branch name.
+func branchOf(repo, key string) string {
+	rel := strings.TrimPrefix(key, repo+"/")
+	parts := strings.SplitN(rel, "/", 2)
+	return parts[0]
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memProvider is a minimal in-memory Provider used to exercise prune logic
+// without a real backend, counting Get calls so tests can assert on
+// backend round trips.
+type memProvider struct {
+	objects map[string][]byte
+	mtimes  map[string]time.Time
+	gets    int
+}
+
+func newMemProvider() *memProvider {
+	return &memProvider{objects: map[string][]byte{}, mtimes: map[string]time.Time{}}
+}
+
+func (m *memProvider) put(key string, data []byte, mtime time.Time) {
+	m.objects[key] = data
+	m.mtimes[key] = mtime
+}
+
+func (m *memProvider) Get(path string) (io.ReadCloser, error) {
+	m.gets++
+	data, ok := m.objects[path]
+	if !ok {
+		return nil, fmt.Errorf("no such object %s", path)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memProvider) Put(path string, contents io.Reader) error {
+	data, err := ioutil.ReadAll(contents)
+	if err != nil {
+		return err
+	}
+	m.objects[path] = data
+	return nil
+}
+
+func (m *memProvider) Exists(path string) (bool, error) {
+	_, ok := m.objects[path]
+	return ok, nil
+}
+
+func (m *memProvider) List(prefix string) ([]Object, error) {
+	var out []Object
+	for key, data := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			out = append(out, Object{Key: key, Size: int64(len(data)), LastModified: m.mtimes[key]})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+func (m *memProvider) Stat(path string) (Object, error) {
+	data, ok := m.objects[path]
+	if !ok {
+		return Object{}, fmt.Errorf("no such object %s", path)
+	}
+	return Object{Key: path, Size: int64(len(data)), LastModified: m.mtimes[path]}, nil
+}
+
+func (m *memProvider) Delete(path string) error {
+	delete(m.objects, path)
+	delete(m.mtimes, path)
+	return nil
+}
+
+// TestEvictUntilUnderBudgetMemoizesReachableData verifies the eviction loop
+// downloads and decodes each surviving snapshot at most once - not once per
+// iteration - by counting Get calls. Pack manifests are loaded through List,
+// which is not counted.
+func TestEvictUntilUnderBudgetMemoizesReachableData(t *testing.T) {
+	p := newMemProvider()
+	repo := "acme/repo"
+	base := time.Now().Add(-time.Hour)
+
+	const n = 5
+	var surviving []Object
+	for i := 0; i < n; i++ {
+		hash := fmt.Sprintf("chunk%d", i)
+		p.put(joinRepo(repo, "main", chunkPrefix, hash), []byte("x"), base)
+
+		snap := &Snapshot{Files: []FileEntry{{Path: "f", Chunks: []string{hash}}}}
+		var buf bytes.Buffer
+		if err := snap.Encode(&buf); err != nil {
+			t.Fatalf("encode snapshot: %v", err)
+		}
+
+		key := joinRepo(repo, "main", fmt.Sprintf("snap-%d", i))
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		p.put(key, buf.Bytes(), mtime)
+		surviving = append(surviving, Object{Key: key, Size: 1, LastModified: mtime})
+	}
+
+	// No data objects are passed in, so only each snapshot's own 1-byte size
+	// counts toward the budget; a budget of 1 byte forces every snapshot but
+	// the newest to be evicted.
+	result, err := evictUntilUnderBudget(p, repo, surviving, nil, 1)
+	if err != nil {
+		t.Fatalf("evictUntilUnderBudget: %v", err)
+	}
+	if len(result) != 1 {
+		t.Fatalf("expected exactly one surviving snapshot, got %d", len(result))
+	}
+
+	// Without memoization this loop re-fetches every still-surviving
+	// snapshot on each of its n iterations - O(n^2) Gets. With it, each
+	// snapshot is fetched exactly once.
+	if p.gets != n {
+		t.Fatalf("expected exactly %d Get calls (one per snapshot), got %d", n, p.gets)
+	}
+}
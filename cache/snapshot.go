@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// FileEntry describes one file captured in a Snapshot: its path relative to
+// the mount root, its mode, and the ordered list of content-addressed chunk
+// hashes that reassemble it.
+type FileEntry struct {
+	Path   string   `json:"path"`
+	Mode   uint32   `json:"mode"`
+	IsDir  bool     `json:"is_dir,omitempty"`
+	Chunks []string `json:"chunks,omitempty"`
+	Size   int64    `json:"size"`
+}
+
+// Snapshot is the manifest uploaded for a cache entry under the
+// content-addressable scheme: a small JSON document listing every file in
+// the mount and the chunk hashes needed to restore it. The chunks
+// themselves live separately under sha256/<hex> (or inside packs).
+type Snapshot struct {
+	Files []FileEntry `json:"files"`
+}
+
+// Encode writes the snapshot as JSON to w.
+func (s *Snapshot) Encode(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// DecodeSnapshot reads a JSON-encoded snapshot from r.
+func DecodeSnapshot(r io.Reader) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,141 @@
+// Package chunker implements content-defined chunking using a rolling
+// Buzhash, so that inserting or removing bytes in a file only changes the
+// chunks adjacent to the edit instead of every chunk after it.
+package chunker
+
+import (
+	"bufio"
+	"io"
+)
+
+// Default chunk size targets, in bytes. MinSize/MaxSize bound the chunker so
+// pathological input (e.g. all-zero files) can't produce degenerate chunks.
+const (
+	DefaultMinSize = 512 * 1024
+	DefaultAvgSize = 1024 * 1024
+	DefaultMaxSize = 8 * 1024 * 1024
+)
+
+const windowSize = 64
+
+// Params configures the chunk size boundaries.
+type Params struct {
+	MinSize int
+	AvgSize int
+	MaxSize int
+}
+
+// WithDefaults fills any zero fields of p with the package defaults.
+func (p Params) WithDefaults() Params {
+	if p.MinSize == 0 {
+		p.MinSize = DefaultMinSize
+	}
+	if p.AvgSize == 0 {
+		p.AvgSize = DefaultAvgSize
+	}
+	if p.MaxSize == 0 {
+		p.MaxSize = DefaultMaxSize
+	}
+	return p
+}
+
+// splitMask is chosen so that, on average, a boundary is found every AvgSize
+// bytes: AvgSize is rounded down to the nearest power of two and a mask of
+// that many low bits is used against the rolling hash.
+func (p Params) splitMask() uint64 {
+	bits := 0
+	for avg := p.AvgSize; avg > 1; avg >>= 1 {
+		bits++
+	}
+	return 1<<uint(bits) - 1
+}
+
+// bufSize is the read-ahead buffer Next reads the rolling hash from.
+// Reading byte-by-byte straight from the source reader (e.g. an *os.File)
+// costs one syscall per byte, which dominates chunking time on large
+// files; buffering amortizes that to one syscall per bufSize bytes.
+const bufSize = 64 * 1024
+
+// Chunker splits a stream into content-defined chunks.
+type Chunker struct {
+	r      *bufio.Reader
+	params Params
+	table  [256]uint64
+	buf    []byte
+	err    error
+}
+
+// New creates a Chunker reading from r using the given size parameters. Zero
+// fields in params fall back to the package defaults.
+func New(r io.Reader, params Params) *Chunker {
+	return &Chunker{
+		r:      bufio.NewReaderSize(r, bufSize),
+		params: params.WithDefaults(),
+		table:  buzhashTable,
+		buf:    make([]byte, 0, params.WithDefaults().MaxSize),
+	}
+}
+
+// Next returns the next chunk of the stream, or io.EOF once the stream is
+// exhausted. The returned slice is only valid until the next call to Next.
+func (c *Chunker) Next() ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	c.buf = c.buf[:0]
+	var h uint64
+	var window [windowSize]byte
+	var wpos int
+
+	mask := c.params.splitMask()
+
+	for {
+		b, err := c.r.ReadByte()
+		if err == nil {
+			c.buf = append(c.buf, b)
+
+			out := window[wpos]
+			window[wpos] = b
+			wpos = (wpos + 1) % windowSize
+
+			h = (h << 1) ^ c.table[b] ^ rotateOut(c.table[out], windowSize)
+
+			if len(c.buf) >= c.params.MinSize {
+				if len(c.buf) >= c.params.MaxSize {
+					return c.buf, nil
+				}
+				if h&mask == 0 {
+					return c.buf, nil
+				}
+			}
+			continue
+		}
+
+		if err == io.EOF {
+			c.err = io.EOF
+			if len(c.buf) == 0 {
+				return nil, io.EOF
+			}
+			return c.buf, nil
+		}
+		c.err = err
+		return nil, err
+	}
+}
+
+func rotateOut(v uint64, n int) uint64 {
+	return v<<uint(n) | v>>uint(64-n)
+}
+
+// buzhashTable holds per-byte pseudo-random constants for the rolling hash.
+var buzhashTable = func() (t [256]uint64) {
+	var x uint64 = 0x9E3779B97F4A7C15
+	for i := range t {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+		t[i] = x
+	}
+	return t
+}()
@@ -0,0 +1,112 @@
+package chunker
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func chunkAll(t *testing.T, data []byte, params Params) [][]byte {
+	t.Helper()
+
+	c := New(bytes.NewReader(data), params)
+	var chunks [][]byte
+	for {
+		chunk, err := c.Next()
+		if err != nil {
+			break
+		}
+		chunks = append(chunks, append([]byte(nil), chunk...))
+	}
+	return chunks
+}
+
+func hashes(chunks [][]byte) []string {
+	out := make([]string, len(chunks))
+	for i, c := range chunks {
+		out[i] = string(c)
+	}
+	return out
+}
+
+// TestChunkerStableAcrossInsertion verifies the whole point of
+// content-defined chunking: inserting bytes in the middle of the input
+// only changes the chunks adjacent to the edit, not every chunk after it.
+func TestChunkerStableAcrossInsertion(t *testing.T) {
+	params := Params{MinSize: 256, AvgSize: 1024, MaxSize: 4096}
+
+	src := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(src)
+
+	before := hashes(chunkAll(t, src, params))
+	if len(before) < 3 {
+		t.Fatalf("test input too small to produce enough chunks: got %d", len(before))
+	}
+
+	insertAt := len(src) / 2
+	edited := append([]byte(nil), src[:insertAt]...)
+	edited = append(edited, []byte("hello world, this is an inserted chunk")...)
+	edited = append(edited, src[insertAt:]...)
+
+	after := hashes(chunkAll(t, edited, params))
+
+	beforeSet := make(map[string]bool, len(before))
+	for _, h := range before {
+		beforeSet[h] = true
+	}
+
+	var unaffectedAfterEdit int
+	for _, h := range after {
+		if beforeSet[h] {
+			unaffectedAfterEdit++
+		}
+	}
+
+	if unaffectedAfterEdit == 0 {
+		t.Fatalf("expected most chunks to survive a localized insertion unchanged, got 0 matches out of %d", len(after))
+	}
+
+	matched := float64(unaffectedAfterEdit) / float64(len(before))
+	if matched < 0.5 {
+		t.Fatalf("only %.0f%% of original chunks survived a single localized insertion, want >=50%%", matched*100)
+	}
+}
+
+// TestChunkerDeterministic verifies chunking the same content twice
+// produces identical chunk boundaries.
+func TestChunkerDeterministic(t *testing.T) {
+	params := Params{MinSize: 256, AvgSize: 1024, MaxSize: 4096}
+
+	src := make([]byte, 128*1024)
+	rand.New(rand.NewSource(2)).Read(src)
+
+	first := hashes(chunkAll(t, src, params))
+	second := hashes(chunkAll(t, src, params))
+
+	if len(first) != len(second) {
+		t.Fatalf("chunk count differs across runs: %d vs %d", len(first), len(second))
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("chunk %d differs across runs", i)
+		}
+	}
+}
+
+// TestChunkerReassembles verifies concatenating every chunk reproduces the
+// original input exactly.
+func TestChunkerReassembles(t *testing.T) {
+	params := Params{MinSize: 256, AvgSize: 1024, MaxSize: 4096}
+
+	src := make([]byte, 64*1024)
+	rand.New(rand.NewSource(3)).Read(src)
+
+	var out []byte
+	for _, chunk := range chunkAll(t, src, params) {
+		out = append(out, chunk...)
+	}
+
+	if !bytes.Equal(out, src) {
+		t.Fatalf("reassembled output does not match source: got %d bytes, want %d", len(out), len(src))
+	}
+}
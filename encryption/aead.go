@@ -0,0 +1,114 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// aeadStream frames a plaintext/ciphertext stream on top of an AEAD cipher:
+// each frame is [4-byte big-endian length][nonce][sealed payload]. A fresh
+// random nonce is drawn per frame so the same key can be reused across many
+// frames (and many uploads) safely.
+type aeadStream struct {
+	aead cipher.AEAD
+}
+
+// encryptingReader reads frameSize plaintext chunks from src, seals each one
+// and emits the framed ciphertext.
+func (s aeadStream) encryptingReader(src io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+
+	go func() {
+		buf := make([]byte, frameSize)
+		nonce := make([]byte, s.aead.NonceSize())
+
+		for {
+			n, err := io.ReadFull(src, buf)
+			if n > 0 {
+				if _, rerr := rand.Read(nonce); rerr != nil {
+					pw.CloseWithError(errors.Wrap(rerr, "could not generate nonce"))
+					return
+				}
+
+				sealed := s.aead.Seal(nil, nonce, buf[:n], nil)
+
+				var length [4]byte
+				binary.BigEndian.PutUint32(length[:], uint32(len(nonce)+len(sealed)))
+
+				if _, werr := pw.Write(length[:]); werr != nil {
+					pw.CloseWithError(werr)
+					return
+				}
+				if _, werr := pw.Write(nonce); werr != nil {
+					pw.CloseWithError(werr)
+					return
+				}
+				if _, werr := pw.Write(sealed); werr != nil {
+					pw.CloseWithError(werr)
+					return
+				}
+			}
+
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				pw.Close()
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return pr
+}
+
+// decryptingReader reads framed ciphertext from src, opening each frame and
+// emitting the recovered plaintext.
+func (s aeadStream) decryptingReader(src io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+
+	go func() {
+		var length [4]byte
+		for {
+			if _, err := io.ReadFull(src, length[:]); err != nil {
+				if err == io.EOF {
+					pw.Close()
+					return
+				}
+				pw.CloseWithError(errors.Wrap(err, "could not read frame length"))
+				return
+			}
+
+			frame := make([]byte, binary.BigEndian.Uint32(length[:]))
+			if _, err := io.ReadFull(src, frame); err != nil {
+				pw.CloseWithError(errors.Wrap(err, "could not read frame"))
+				return
+			}
+
+			nonceSize := s.aead.NonceSize()
+			if len(frame) < nonceSize {
+				pw.CloseWithError(errors.New("ciphertext frame shorter than nonce"))
+				return
+			}
+			nonce, sealed := frame[:nonceSize], frame[nonceSize:]
+
+			plain, err := s.aead.Open(nil, nonce, sealed, nil)
+			if err != nil {
+				pw.CloseWithError(errors.Wrap(err, "could not decrypt frame"))
+				return
+			}
+
+			if _, err := pw.Write(plain); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return pr
+}
@@ -0,0 +1,25 @@
+// Package encryption provides client-side encryption of the cache stream,
+// independent of whatever server-side encryption the storage backend may
+// also offer.
+package encryption
+
+import "io"
+
+// Encryptor wraps a plaintext stream into a self-describing ciphertext
+// stream for storage, and unwraps it again on restore. Implementations
+// stream in bounded-size frames rather than buffering the whole object, so
+// large caches don't have to fit in memory.
+type Encryptor interface {
+	// Encrypt returns a reader that yields the ciphertext for the
+	// plaintext read from r, including whatever header is needed to
+	// decrypt it later (salt, wrapped key, ...).
+	Encrypt(r io.Reader) (io.Reader, error)
+	// Decrypt returns a reader that yields the plaintext for the
+	// ciphertext stream read from r, as produced by Encrypt.
+	Decrypt(r io.Reader) (io.Reader, error)
+}
+
+// frameSize is the size of plaintext buffered into a single AEAD frame.
+// Framing bounds memory use and gives each frame its own nonce, so the
+// overall stream can be encrypted/decrypted without holding it all in RAM.
+const frameSize = 1024 * 1024
@@ -0,0 +1,91 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/pkg/errors"
+)
+
+// kmsEncryptor implements envelope encryption against AWS KMS: every
+// Encrypt call asks KMS for a fresh data encryption key (DEK), uses the
+// plaintext DEK to seal the stream locally with AES-256-GCM, and stores the
+// KMS-wrapped DEK in the stream header so Decrypt can ask KMS to unwrap it
+// again. The plaintext DEK itself is never persisted.
+type kmsEncryptor struct {
+	keyID  string
+	client *kms.KMS
+}
+
+// NewKMSEncryptor builds an Encryptor that wraps per-object data keys with
+// the given KMS key ID.
+func NewKMSEncryptor(keyID string) (Encryptor, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create aws session")
+	}
+	return &kmsEncryptor{keyID: keyID, client: kms.New(sess)}, nil
+}
+
+func (e *kmsEncryptor) Encrypt(r io.Reader) (io.Reader, error) {
+	out, err := e.client.GenerateDataKey(&kms.GenerateDataKeyInput{
+		KeyId:   aws.String(e.keyID),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not generate data key")
+	}
+
+	aead, err := newAESGCM(out.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	var wrappedLen [4]byte
+	binary.BigEndian.PutUint32(wrappedLen[:], uint32(len(out.CiphertextBlob)))
+	header.Write(wrappedLen[:])
+	header.Write(out.CiphertextBlob)
+
+	stream := aeadStream{aead: aead}
+	return io.MultiReader(bytes.NewReader(header.Bytes()), stream.encryptingReader(r)), nil
+}
+
+func (e *kmsEncryptor) Decrypt(r io.Reader) (io.Reader, error) {
+	var wrappedLen [4]byte
+	if _, err := io.ReadFull(r, wrappedLen[:]); err != nil {
+		return nil, errors.Wrap(err, "could not read wrapped key length")
+	}
+
+	wrapped := make([]byte, binary.BigEndian.Uint32(wrappedLen[:]))
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, errors.Wrap(err, "could not read wrapped key")
+	}
+
+	out, err := e.client.Decrypt(&kms.DecryptInput{CiphertextBlob: wrapped})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not unwrap data key")
+	}
+
+	aead, err := newAESGCM(out.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := aeadStream{aead: aead}
+	return stream.decryptingReader(r), nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create aes cipher")
+	}
+	return cipher.NewGCM(block)
+}
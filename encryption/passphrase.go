@@ -0,0 +1,115 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const saltSize = 16
+
+// CipherSuite selects the AEAD used to seal each frame.
+type CipherSuite byte
+
+// Supported cipher suites for passphrase-derived encryption.
+const (
+	AES256GCM CipherSuite = iota + 1
+	ChaCha20Poly1305
+)
+
+// Argon2Params configures the Argon2id key derivation. Zero values fall
+// back to argon2.IDKey's recommended interactive parameters.
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+func (p Argon2Params) withDefaults() Argon2Params {
+	if p.Time == 0 {
+		p.Time = 1
+	}
+	if p.Memory == 0 {
+		p.Memory = 64 * 1024
+	}
+	if p.Threads == 0 {
+		p.Threads = 4
+	}
+	return p
+}
+
+// passphraseEncryptor derives a per-object key from a passphrase via
+// Argon2id. The salt is generated fresh for every Encrypt call and written
+// as a plaintext header so Decrypt can re-derive the same key.
+type passphraseEncryptor struct {
+	passphrase string
+	suite      CipherSuite
+	params     Argon2Params
+}
+
+// NewPassphraseEncryptor builds an Encryptor that derives its key from
+// passphrase using Argon2id, sealing frames with suite.
+func NewPassphraseEncryptor(passphrase string, suite CipherSuite, params Argon2Params) Encryptor {
+	return &passphraseEncryptor{passphrase: passphrase, suite: suite, params: params.withDefaults()}
+}
+
+func (e *passphraseEncryptor) Encrypt(r io.Reader) (io.Reader, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "could not generate salt")
+	}
+
+	aead, err := e.newAEAD(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 1+saltSize)
+	header[0] = byte(e.suite)
+	copy(header[1:], salt)
+
+	stream := aeadStream{aead: aead}
+	return io.MultiReader(bytes.NewReader(header), stream.encryptingReader(r)), nil
+}
+
+func (e *passphraseEncryptor) Decrypt(r io.Reader) (io.Reader, error) {
+	header := make([]byte, 1+saltSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.Wrap(err, "could not read encryption header")
+	}
+
+	suite := CipherSuite(header[0])
+	salt := header[1:]
+
+	aead, err := (&passphraseEncryptor{passphrase: e.passphrase, suite: suite, params: e.params}).newAEAD(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := aeadStream{aead: aead}
+	return stream.decryptingReader(r), nil
+}
+
+func (e *passphraseEncryptor) newAEAD(salt []byte) (cipher.AEAD, error) {
+	var keyLen uint32 = 32
+	key := argon2.IDKey([]byte(e.passphrase), salt, e.params.Time, e.params.Memory, e.params.Threads, keyLen)
+
+	switch e.suite {
+	case ChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	case AES256GCM, 0:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create aes cipher")
+		}
+		return cipher.NewGCM(block)
+	default:
+		return nil, errors.Errorf("unsupported cipher suite %d", e.suite)
+	}
+}
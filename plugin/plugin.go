@@ -1,20 +1,35 @@
 package plugin
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/meltwater/drone-s3-cache/cache"
+	"github.com/meltwater/drone-s3-cache/chunker"
+	"github.com/meltwater/drone-s3-cache/encryption"
 	"github.com/meltwater/drone-s3-cache/provider"
+	"github.com/meltwater/drone-s3-cache/retry"
 )
 
 // Plugin for caching directories using given Providers
@@ -47,77 +62,618 @@ type Plugin struct {
 	Repo      string
 	Restore   bool
 	Secret    string
+
+	// Backend selects which storage system the cache is read from and
+	// written to. Defaults to provider.BackendS3 when empty.
+	Backend provider.Backend
+
+	// GCS-specific configuration, used when Backend is BackendGCS.
+	GCSCredentialsFile string
+
+	// Azure Blob Storage configuration, used when Backend is
+	// BackendAzureBlob.
+	AzureAccount    string
+	AzureAccountKey string
+
+	// MinIO-specific configuration, used when Backend is BackendMinio.
+	// This talks to MinIO natively via minio-go rather than through the
+	// aws-sdk-go S3 path used for BackendS3.
+	MinioUseSSL bool
+
+	// SFTP-specific configuration, used when Backend is BackendSFTP.
+	SFTPAddress  string
+	SFTPRoot     string
+	SFTPUsername string
+	SFTPPassword string
+
+	// Filesystem-specific configuration, used when Backend is
+	// BackendFilesystem.
+	FilesystemRoot string
+
+	// ChunkedCache switches the cache format from a single tar archive per
+	// mount to a content-addressable, deduplicated set of chunks plus a
+	// small snapshot manifest. Both formats are stored under the same
+	// keys and are not told apart: a restore with this enabled that finds
+	// a tar-format entry fails to decode it as a snapshot.
+	ChunkedCache bool
+	// ChunkMinSize, ChunkAvgSize and ChunkMaxSize bound the content-defined
+	// chunker. Zero values fall back to chunker.Default*.
+	ChunkMinSize int
+	ChunkAvgSize int
+	ChunkMaxSize int
+	// CompressionLevel is the zstd level used to compress each chunk.
+	CompressionLevel int
+	// PackSize, if positive, batches every chunk into pack files of roughly
+	// this many bytes instead of uploading each as its own object. Zero
+	// disables packing.
+	PackSize int
+
+	// EncryptionMode selects client-side encryption of the cache stream,
+	// independent of the server-side Encryption header above. Valid
+	// values are "" (disabled), "passphrase" or "kms".
+	EncryptionMode string
+	// Passphrase is the secret Argon2id derives the data key from when
+	// EncryptionMode is "passphrase".
+	Passphrase string
+	// KMSKeyID is the AWS KMS key used for envelope encryption when
+	// EncryptionMode is "kms".
+	KMSKeyID string
+
+	// Flush enumerates cached objects under Repo and deletes whichever
+	// fall outside FlushAge, MaxCacheSize or KeepPerBranch.
+	Flush bool
+	// FlushAge removes cache entries last modified longer than this ago.
+	// Zero disables age-based eviction.
+	FlushAge time.Duration
+	// MaxCacheSize evicts the least-recently-modified entries, after
+	// FlushAge has been applied, until Repo is back under this many
+	// bytes. Zero disables size-based eviction.
+	MaxCacheSize int64
+	// KeepPerBranch retains only the N most recently modified entries per
+	// branch, regardless of age or size, so feature branches don't
+	// accumulate forever. Zero disables this check.
+	KeepPerBranch int
+
+	// FallbackBranches lists branches to try restoring from, in order,
+	// after Branch itself misses. Default, if set, is always tried last.
+	FallbackBranches []string
+	// RestoreKeys overrides the default branch fallback chain entirely
+	// with an explicit, ordered list of key templates. Each template may
+	// reference {{.Repo}}, {{.Mount}}, {{.Branch}} and {{.Checksum}}; the
+	// first one that exists in the cache wins.
+	RestoreKeys []string
+	// LockFile, if set, is hashed to populate the {{.Checksum}} template
+	// variable used by RestoreKeys (e.g. go.sum, package-lock.json).
+	LockFile string
+
+	// AssumeRoleARN, if set, has the plugin assume this role via STS
+	// before talking to S3, chaining on top of the static Key/Secret (or
+	// the ambient instance role) used to call AssumeRole itself.
+	AssumeRoleARN         string
+	AssumeRoleSessionName string
+	ExternalID            string
+	// WebIdentityTokenFile and OIDCTokenPath both select web-identity
+	// federation (e.g. EKS IRSA, GitHub OIDC) instead of a plain
+	// AssumeRole call; WebIdentityTokenFile takes precedence if both are
+	// set. AssumeRoleARN is still required to pick the role to assume.
+	WebIdentityTokenFile string
+	OIDCTokenPath        string
+
+	// Concurrency bounds how many mounts are rebuilt or restored at once,
+	// and (when ChunkedCache is set and PackSize is 0) how many chunks
+	// within a mount upload at once. One (sequential) if unset.
+	Concurrency int
+	// MaxRetries bounds how many times a transient cache-provider failure
+	// (throttling, timeouts, connection resets) is retried before the
+	// whole rebuild/restore/flush gives up. Zero falls back to retry's own
+	// default.
+	MaxRetries int
+	// BaseDelay is the initial backoff between retries; it doubles after
+	// each one. Zero falls back to retry's own default.
+	BaseDelay time.Duration
+
+	// S3PartSize and S3UploadConcurrency tune the S3 multipart uploader
+	// used when Backend is BackendS3. Zero values fall back to the
+	// s3manager defaults.
+	S3PartSize          int64
+	S3UploadConcurrency int
+}
+
+// RestoreKeyData is the template data available to RestoreKeys entries.
+type RestoreKeyData struct {
+	Repo     string
+	Mount    string
+	Branch   string
+	Checksum string
 }
 
+// Client-side encryption modes for EncryptionMode.
+const (
+	EncryptionModePassphrase = "passphrase"
+	EncryptionModeKMS        = "kms"
+)
+
 // Exec entry point of Plugin, where the magic happens
 func (p *Plugin) Exec() error {
-	conf := &aws.Config{
-		Region:   aws.String(p.Region),
-		Endpoint: &p.Endpoint,
-		// TODO: Check any consequences?
-		// DisableSSL:       aws.Bool(strings.HasPrefix(p.Endpoint, "http://")),
-		DisableSSL:       aws.Bool(!strings.HasPrefix(p.Endpoint, "https://")),
-		S3ForcePathStyle: aws.Bool(p.PathStyle),
+	cacheProvider, err := p.newCacheProvider()
+	if err != nil {
+		return errors.Wrap(err, "could not create cache provider")
 	}
+	cacheProvider = provider.WithRetry(cacheProvider, retry.Config{MaxRetries: p.MaxRetries, BaseDelay: p.BaseDelay})
 
-	// allowing to use the instance role or provide a key and secret
-	if p.Key != "" && p.Secret != "" {
-		conf.Credentials = credentials.NewStaticCredentials(p.Key, p.Secret, "")
+	encryptor, err := p.newEncryptor()
+	if err != nil {
+		return errors.Wrap(err, "could not create encryptor")
 	}
-	// TODO: Else return and error
 	// TODO: Check if both (rebuild, restore) of them set.
 
-	cacheProvider := provider.NewS3(p.Bucket, p.ACL, p.Encryption, conf)
-
 	if p.Rebuild {
-		if err := p.processRebuild(cacheProvider); err != nil {
+		if err := p.processRebuild(cacheProvider, encryptor); err != nil {
 			return errors.Wrap(err, "process rebuild failed")
 		}
 	}
 
 	if p.Restore {
-		if err := p.processRestore(cacheProvider); err != nil {
+		if err := p.processRestore(cacheProvider, encryptor); err != nil {
 			return errors.Wrap(err, "process restore failed")
 		}
 	}
 
+	if p.Flush {
+		if err := p.processFlush(cacheProvider); err != nil {
+			return errors.Wrap(err, "process flush failed")
+		}
+	}
+
 	return nil
 }
 
 // Helpers
 
-// processRebuild the remote cache from the local environment
-func (p Plugin) processRebuild(c cache.Provider) error {
+// newEncryptor builds the client-side encryption.Encryptor for the
+// configured EncryptionMode, or returns nil if client-side encryption is
+// disabled.
+func (p *Plugin) newEncryptor() (encryption.Encryptor, error) {
+	if p.Passphrase != "" && p.KMSKeyID != "" {
+		return nil, errors.New("passphrase and kms-key-id are mutually exclusive")
+	}
+
+	switch p.EncryptionMode {
+	case "":
+		return nil, nil
+
+	case EncryptionModePassphrase:
+		if p.Passphrase == "" {
+			return nil, errors.New("encryption-mode passphrase requires a passphrase")
+		}
+		return encryption.NewPassphraseEncryptor(p.Passphrase, encryption.AES256GCM, encryption.Argon2Params{}), nil
+
+	case EncryptionModeKMS:
+		if p.KMSKeyID == "" {
+			return nil, errors.New("encryption-mode kms requires a kms-key-id")
+		}
+		return encryption.NewKMSEncryptor(p.KMSKeyID)
+
+	default:
+		return nil, errors.Errorf("unsupported encryption mode %q", p.EncryptionMode)
+	}
+}
+
+// s3Config builds the aws.Config for the S3 backend, chaining static
+// key/secret (or the ambient instance role) with an optional STS
+// AssumeRole or web-identity federation on top.
+func (p *Plugin) s3Config() (*aws.Config, error) {
+	conf := &aws.Config{
+		Region:           aws.String(p.Region),
+		Endpoint:         &p.Endpoint,
+		DisableSSL:       aws.Bool(!strings.HasPrefix(p.Endpoint, "https://")),
+		S3ForcePathStyle: aws.Bool(p.PathStyle),
+	}
+
+	// allowing to use the instance role or provide a key and secret
+	if p.Key != "" && p.Secret != "" {
+		conf.Credentials = credentials.NewStaticCredentials(p.Key, p.Secret, "")
+	}
+
+	tokenFile := p.WebIdentityTokenFile
+	if tokenFile == "" {
+		tokenFile = p.OIDCTokenPath
+	}
+
+	switch {
+	case tokenFile != "":
+		if p.AssumeRoleARN == "" {
+			return nil, errors.New("web identity federation requires assume-role-arn")
+		}
+		sess, err := session.NewSession(conf)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create aws session")
+		}
+		conf.Credentials = stscreds.NewWebIdentityCredentials(sess, p.AssumeRoleARN, p.AssumeRoleSessionName, tokenFile)
+
+	case p.AssumeRoleARN != "":
+		sess, err := session.NewSession(conf)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create aws session")
+		}
+		conf.Credentials = stscreds.NewCredentials(sess, p.AssumeRoleARN, func(r *stscreds.AssumeRoleProvider) {
+			r.RoleSessionName = p.AssumeRoleSessionName
+			if p.ExternalID != "" {
+				r.ExternalID = aws.String(p.ExternalID)
+			}
+		})
+	}
+
+	return conf, nil
+}
+
+// newCacheProvider builds the cache.Provider for the configured Backend,
+// defaulting to S3 for backwards compatibility with existing pipelines.
+func (p *Plugin) newCacheProvider() (cache.Provider, error) {
+	backend := p.Backend
+	if backend == "" {
+		backend = provider.BackendS3
+	}
+
+	switch backend {
+	case provider.BackendS3:
+		conf, err := p.s3Config()
+		if err != nil {
+			return nil, err
+		}
+		upload := provider.UploadConfig{PartSize: p.S3PartSize, Concurrency: p.S3UploadConcurrency}
+		return provider.NewS3(p.Bucket, p.ACL, p.Encryption, conf, upload), nil
+
+	case provider.BackendGCS:
+		return provider.NewGCS(p.Bucket, p.GCSCredentialsFile)
+
+	case provider.BackendAzureBlob:
+		return provider.NewAzureBlob(p.AzureAccount, p.AzureAccountKey, p.Bucket)
+
+	case provider.BackendMinio:
+		return provider.NewMinio(p.Endpoint, p.Key, p.Secret, p.Bucket, p.MinioUseSSL)
+
+	case provider.BackendSFTP:
+		config := &ssh.ClientConfig{
+			User:            p.SFTPUsername,
+			Auth:            []ssh.AuthMethod{ssh.Password(p.SFTPPassword)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		}
+		return provider.NewSFTP(p.SFTPAddress, p.SFTPRoot, config)
+
+	case provider.BackendFilesystem:
+		return provider.NewFilesystem(p.FilesystemRoot), nil
+
+	default:
+		return nil, errors.Errorf("unsupported backend %q", backend)
+	}
+}
+
+// processRebuild the remote cache from the local environment. Mounts are
+// uploaded concurrently, bounded by Concurrency; the first hard failure
+// (e.g. bad credentials) cancels every mount that hasn't started yet
+// instead of paying for all of their transfers first.
+func (p Plugin) processRebuild(c cache.Provider, enc encryption.Encryptor) error {
 	now := time.Now()
-	for _, mount := range p.Mount {
-		cacheKey := hash(mount, p.Branch)
-		path := filepath.Join(p.Repo, cacheKey)
 
-		log.Printf("archiving directory <%s> to remote cache <%s>", mount, path)
-		if err := cache.Upload(c, mount, path); err != nil {
-			return errors.Wrap(err, "could not upload")
+	var total int64
+	group, ctx := errgroup.WithContext(context.Background())
+	sem := make(chan struct{}, concurrencyOrDefault(p.Concurrency))
+dispatch:
+	for _, mount := range p.Mount {
+		mount := mount
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case sem <- struct{}{}:
 		}
+		group.Go(func() error {
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			size, err := p.uploadMount(c, enc, mount)
+			if err == nil {
+				atomic.AddInt64(&total, size)
+			}
+			return err
+		})
 	}
-	log.Printf("cache built in %v", time.Since(now))
+	if err := group.Wait(); err != nil {
+		return err
+	}
+
+	elapsed := time.Since(now)
+	log.Printf("cache built in %v (%.2f MB/s)", elapsed, throughput(total, elapsed))
 	return nil
 }
 
-// processRestore the local environment from the remote cache
-func (p Plugin) processRestore(c cache.Provider) error {
+// uploadMount archives a single mount and returns the number of bytes
+// actually transferred to the backend.
+func (p Plugin) uploadMount(c cache.Provider, enc encryption.Encryptor, mount string) (int64, error) {
+	path, err := p.primaryCachePath(mount)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not build cache key")
+	}
+	log.Printf("archiving directory <%s> to remote cache <%s>", mount, path)
+
+	if p.ChunkedCache {
+		transferred, err := cache.UploadChunked(c, p.chunkConfig(), enc, mount, path)
+		if err != nil {
+			return 0, errors.Wrap(err, "could not upload")
+		}
+		return transferred, nil
+	}
+
+	size, err := dirSize(mount)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not measure mount size")
+	}
+
+	if err := cache.Upload(c, enc, mount, path); err != nil {
+		return 0, errors.Wrap(err, "could not upload")
+	}
+	return size, nil
+}
+
+// processRestore the local environment from the remote cache. Mounts are
+// restored concurrently, bounded by Concurrency; the first hard failure
+// cancels every mount that hasn't started yet instead of paying for all of
+// their transfers first.
+func (p Plugin) processRestore(c cache.Provider, enc encryption.Encryptor) error {
 	now := time.Now()
+
+	var total int64
+	group, ctx := errgroup.WithContext(context.Background())
+	sem := make(chan struct{}, concurrencyOrDefault(p.Concurrency))
+dispatch:
 	for _, mount := range p.Mount {
-		cacheKey := hash(mount, p.Branch)
-		path := filepath.Join(p.Repo, cacheKey)
+		mount := mount
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case sem <- struct{}{}:
+		}
+		group.Go(func() error {
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			size, err := p.restoreMount(c, enc, mount)
+			if err == nil {
+				atomic.AddInt64(&total, size)
+			}
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+
+	elapsed := time.Since(now)
+	log.Printf("cache restored in %v (%.2f MB/s)", elapsed, throughput(total, elapsed))
+	return nil
+}
+
+// restoreMount restores a single mount and returns the number of bytes
+// written, or 0 if no cache entry was found for it.
+func (p Plugin) restoreMount(c cache.Provider, enc encryption.Encryptor, mount string) (int64, error) {
+	candidates, err := p.restoreCandidates(mount)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not build restore keys")
+	}
+
+	path, err := firstExisting(c, candidates)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not look up restore keys")
+	}
+	if path == "" {
+		log.Printf("no cache found for <%s>, tried %d key(s)", mount, len(candidates))
+		return 0, nil
+	}
+
+	log.Printf("restoring directory <%s> from remote cache <%s>", mount, path)
+
+	if p.ChunkedCache {
+		if err := cache.DownloadChunked(c, enc, path, mount); err != nil {
+			return 0, errors.Wrap(err, "could not download")
+		}
+	} else if err := cache.Download(c, enc, path, mount); err != nil {
+		return 0, errors.Wrap(err, "could not download")
+	}
+
+	size, err := dirSize(mount)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not measure restored size")
+	}
+	return size, nil
+}
+
+// restoreCandidates builds the ordered list of cache keys to try restoring
+// mount from. RestoreKeys, if set, take over the chain entirely; otherwise
+// the chain is Branch, then each of FallbackBranches, then Default.
+func (p Plugin) restoreCandidates(mount string) ([]string, error) {
+	if len(p.RestoreKeys) > 0 {
+		checksum, err := p.lockfileChecksum()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not hash lockfile")
+		}
+		data := RestoreKeyData{Repo: p.Repo, Mount: mount, Branch: p.Branch, Checksum: checksum}
+
+		keys := make([]string, 0, len(p.RestoreKeys))
+		for i, raw := range p.RestoreKeys {
+			tmpl, err := template.New(fmt.Sprintf("restore-key-%d", i)).Parse(raw)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not parse restore key %q", raw)
+			}
+
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, data); err != nil {
+				return nil, errors.Wrapf(err, "could not render restore key %q", raw)
+			}
+			keys = append(keys, buf.String())
+		}
+		return keys, nil
+	}
+
+	branches := append([]string{p.Branch}, p.FallbackBranches...)
+	if p.Default != "" {
+		branches = append(branches, p.Default)
+	}
+
+	seen := make(map[string]bool, len(branches))
+	keys := make([]string, 0, len(branches)*2)
+	for _, branch := range branches {
+		if seen[branch] {
+			continue
+		}
+		seen[branch] = true
+		keys = append(keys, filepath.Join(p.Repo, branch, hash(mount, branch)))
+		// Fall back to the pre-branch-scoped key layout so upgrading to
+		// this plugin version doesn't immediately miss every existing
+		// cache entry; see cachePath.
+		keys = append(keys, legacyCachePath(p.Repo, mount, branch))
+	}
+	return keys, nil
+}
+
+// lockfileChecksum hashes LockFile for the {{.Checksum}} restore key
+// template variable, or returns "" if no LockFile is configured.
+func (p Plugin) lockfileChecksum() (string, error) {
+	if p.LockFile == "" {
+		return "", nil
+	}
+
+	contents, err := ioutil.ReadFile(p.LockFile)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:]), nil
+}
 
-		log.Printf("restoring directory <%s> from remote cache <%s>", mount, path)
-		if err := cache.Download(c, path, mount); err != nil {
-			return errors.Wrap(err, "could not download")
+// firstExisting returns the first candidate key present in c, or "" if
+// none of them are.
+func firstExisting(c cache.Provider, candidates []string) (string, error) {
+	for _, key := range candidates {
+		exists, err := c.Exists(key)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return key, nil
 		}
 	}
-	log.Printf("cache restored in %v", time.Since(now))
+	return "", nil
+}
+
+// processFlush prunes cache entries under Repo per FlushAge, MaxCacheSize
+// and KeepPerBranch.
+func (p Plugin) processFlush(c cache.Provider) error {
+	now := time.Now()
+
+	result, err := cache.Prune(c, p.Repo, cache.PruneOptions{
+		FlushAge:      p.FlushAge,
+		MaxCacheSize:  p.MaxCacheSize,
+		KeepPerBranch: p.KeepPerBranch,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("pruned %d objects (%d bytes freed) in %v", result.ObjectsRemoved, result.BytesFreed, time.Since(now))
 	return nil
 }
 
+// cachePath builds the object key a mount's cache entry is stored under,
+// scoped by branch so KeepPerBranch retention can group entries together.
+//
+// This is a breaking change from the pre-KeepPerBranch key layout
+// (Repo/hash(mount,branch), see legacyCachePath): every new rebuild is
+// written under the new, branch-scoped key, but restoreCandidates still
+// checks the legacy key as a fallback so existing cache entries aren't
+// simply orphaned on upgrade.
+func (p Plugin) cachePath(mount string) string {
+	cacheKey := hash(mount, p.Branch)
+	return filepath.Join(p.Repo, p.Branch, cacheKey)
+}
+
+// legacyCachePath reproduces the cache key layout used before
+// KeepPerBranch scoped entries under their branch, so restoreCandidates
+// can still find a mount's cache entry from before this upgrade.
+func legacyCachePath(repo, mount, branch string) string {
+	return filepath.Join(repo, hash(mount, branch))
+}
+
+// primaryCachePath builds the object key a mount's cache entry is written
+// to. When RestoreKeys overrides the default branch fallback chain, the
+// rendered first entry is used instead of cachePath, so the exact key a
+// restore tries first (e.g. one keyed off a lockfile checksum) is the one
+// a rebuild actually wrote to — otherwise RestoreKeys could never hit.
+func (p Plugin) primaryCachePath(mount string) (string, error) {
+	if len(p.RestoreKeys) == 0 {
+		return p.cachePath(mount), nil
+	}
+
+	keys, err := p.restoreCandidates(mount)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", errors.New("restore-keys is set but rendered no keys")
+	}
+	return keys[0], nil
+}
+
+// chunkConfig builds the cache.ChunkConfig for the content-addressable
+// pipeline from the plugin's flat config fields.
+func (p Plugin) chunkConfig() cache.ChunkConfig {
+	return cache.ChunkConfig{
+		Params: chunker.Params{
+			MinSize: p.ChunkMinSize,
+			AvgSize: p.ChunkAvgSize,
+			MaxSize: p.ChunkMaxSize,
+		},
+		CompressionLevel: p.CompressionLevel,
+		PackSize:         p.PackSize,
+		Concurrency:      p.Concurrency,
+	}
+}
+
+// dirSize sums the size of every regular file under path.
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// throughput reports bytes transferred over d in megabytes per second.
+func throughput(bytes int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(bytes) / (1024 * 1024) / d.Seconds()
+}
+
+// concurrencyOrDefault returns n, or 1 (sequential) if n is zero or negative.
+func concurrencyOrDefault(n int) int {
+	if n <= 0 {
+		return 1
+	}
+	return n
+}
+
 // hash a file name based on path and branch
 func hash(mount, branch string) string {
 	parts := []string{mount, branch}
@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"testing"
+
+	"github.com/meltwater/drone-s3-cache/cache"
+)
+
+// memProvider is a minimal in-memory cache.Provider, just enough to
+// exercise key lookups without a real backend.
+type memProvider struct {
+	objects map[string][]byte
+}
+
+func newMemProvider() *memProvider {
+	return &memProvider{objects: map[string][]byte{}}
+}
+
+func (m *memProvider) Get(path string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(m.objects[path])), nil
+}
+
+func (m *memProvider) Put(path string, contents io.Reader) error {
+	data, err := ioutil.ReadAll(contents)
+	if err != nil {
+		return err
+	}
+	m.objects[path] = data
+	return nil
+}
+
+func (m *memProvider) Exists(path string) (bool, error) {
+	_, ok := m.objects[path]
+	return ok, nil
+}
+
+func (m *memProvider) List(prefix string) ([]cache.Object, error) { return nil, nil }
+
+func (m *memProvider) Stat(path string) (cache.Object, error) {
+	return cache.Object{Key: path, Size: int64(len(m.objects[path]))}, nil
+}
+
+func (m *memProvider) Delete(path string) error {
+	delete(m.objects, path)
+	return nil
+}
+
+// TestPrimaryCachePathMatchesRestoreCandidate verifies the key uploadMount
+// writes to is the same one restoreCandidates tries first, so a rebuild
+// with RestoreKeys set is actually findable on restore.
+func TestPrimaryCachePathMatchesRestoreCandidate(t *testing.T) {
+	p := Plugin{
+		Repo:        "acme/repo",
+		Branch:      "feature/foo",
+		RestoreKeys: []string{"{{.Repo}}/{{.Mount}}-{{.Checksum}}", "{{.Repo}}/{{.Mount}}-fallback"},
+	}
+
+	path, err := p.primaryCachePath("node_modules")
+	if err != nil {
+		t.Fatalf("primaryCachePath: %v", err)
+	}
+
+	candidates, err := p.restoreCandidates("node_modules")
+	if err != nil {
+		t.Fatalf("restoreCandidates: %v", err)
+	}
+	if len(candidates) == 0 {
+		t.Fatal("restoreCandidates returned no keys")
+	}
+
+	if path != candidates[0] {
+		t.Fatalf("primaryCachePath = %q, want restoreCandidates[0] = %q", path, candidates[0])
+	}
+
+	// Round trip: writing under primaryCachePath must be visible to the
+	// same fallback chain restore uses to look the key up.
+	c := newMemProvider()
+	if err := c.Put(path, bytes.NewReader([]byte("cached"))); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	found, err := firstExisting(c, candidates)
+	if err != nil {
+		t.Fatalf("firstExisting: %v", err)
+	}
+	if found != path {
+		t.Fatalf("firstExisting = %q, want %q", found, path)
+	}
+}
+
+// TestPrimaryCachePathWithoutRestoreKeys verifies primaryCachePath falls
+// back to the plain branch-scoped cachePath when RestoreKeys isn't set.
+func TestPrimaryCachePathWithoutRestoreKeys(t *testing.T) {
+	p := Plugin{Repo: "acme/repo", Branch: "main"}
+
+	path, err := p.primaryCachePath("node_modules")
+	if err != nil {
+		t.Fatalf("primaryCachePath: %v", err)
+	}
+
+	if want := p.cachePath("node_modules"); path != want {
+		t.Fatalf("primaryCachePath = %q, want cachePath = %q", path, want)
+	}
+}
@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/pkg/errors"
+
+	"github.com/meltwater/drone-s3-cache/cache"
+)
+
+// azureBlobProvider is a cache.Provider backed by Azure Blob Storage.
+type azureBlobProvider struct {
+	container azblob.ContainerURL
+}
+
+// NewAzureBlob builds a cache.Provider targeting an Azure Blob Storage
+// container, authenticating with the given storage account name and key.
+func NewAzureBlob(account, accountKey, container string) (cache.Provider, error) {
+	credential, err := azblob.NewSharedKeyCredential(account, accountKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create azure credential")
+	}
+
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	u, err := url.Parse("https://" + account + ".blob.core.windows.net/" + container)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build azure container url")
+	}
+
+	return &azureBlobProvider{container: azblob.NewContainerURL(*u, pipeline)}, nil
+}
+
+func (p *azureBlobProvider) Get(path string) (io.ReadCloser, error) {
+	blob := p.container.NewBlockBlobURL(path)
+
+	resp, err := blob.Download(context.Background(), 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get object")
+	}
+
+	return resp.Body(azblob.RetryReaderOptions{}), nil
+}
+
+func (p *azureBlobProvider) Exists(path string) (bool, error) {
+	blob := p.container.NewBlockBlobURL(path)
+
+	_, err := blob.GetProperties(context.Background(), azblob.BlobAccessConditions{})
+	if err != nil {
+		if stgErr, ok := err.(azblob.StorageError); ok && stgErr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "could not stat blob")
+	}
+	return true, nil
+}
+
+func (p *azureBlobProvider) Put(path string, contents io.Reader) error {
+	blob := p.container.NewBlockBlobURL(path)
+
+	_, err := azblob.UploadStreamToBlockBlob(context.Background(), contents, blob, azblob.UploadStreamToBlockBlobOptions{})
+	return errors.Wrap(err, "could not upload object")
+}
+
+func (p *azureBlobProvider) List(prefix string) ([]cache.Object, error) {
+	var objects []cache.Object
+
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := p.container.ListBlobsFlatSegment(context.Background(), marker, azblob.ListBlobsSegmentOptions{
+			Prefix: prefix,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "could not list blobs")
+		}
+
+		for _, blob := range resp.Segment.BlobItems {
+			objects = append(objects, cache.Object{
+				Key:          blob.Name,
+				Size:         *blob.Properties.ContentLength,
+				LastModified: blob.Properties.LastModified,
+			})
+		}
+
+		marker = resp.NextMarker
+	}
+	return objects, nil
+}
+
+func (p *azureBlobProvider) Stat(path string) (cache.Object, error) {
+	blob := p.container.NewBlockBlobURL(path)
+
+	props, err := blob.GetProperties(context.Background(), azblob.BlobAccessConditions{})
+	if err != nil {
+		return cache.Object{}, errors.Wrap(err, "could not stat blob")
+	}
+
+	return cache.Object{Key: path, Size: props.ContentLength(), LastModified: props.LastModified()}, nil
+}
+
+func (p *azureBlobProvider) Delete(path string) error {
+	blob := p.container.NewBlockBlobURL(path)
+
+	_, err := blob.Delete(context.Background(), azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{})
+	return errors.Wrap(err, "could not delete blob")
+}
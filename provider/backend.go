@@ -0,0 +1,14 @@
+package provider
+
+// Backend identifies which storage system a cache.Provider talks to.
+type Backend string
+
+// Supported storage backends.
+const (
+	BackendS3         Backend = "s3"
+	BackendGCS        Backend = "gcs"
+	BackendAzureBlob  Backend = "azure"
+	BackendMinio      Backend = "minio"
+	BackendSFTP       Backend = "sftp"
+	BackendFilesystem Backend = "filesystem"
+)
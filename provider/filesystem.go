@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/meltwater/drone-s3-cache/cache"
+)
+
+// filesystemProvider is a cache.Provider backed by a directory on the local
+// (or a mounted network) filesystem. Mainly useful for testing and for
+// runners that share a persistent volume between builds.
+type filesystemProvider struct {
+	root string
+}
+
+// NewFilesystem builds a cache.Provider rooted at the given local directory.
+func NewFilesystem(root string) cache.Provider {
+	return &filesystemProvider{root: root}
+}
+
+func (p *filesystemProvider) Get(path string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(p.root, path))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open file")
+	}
+	return f, nil
+}
+
+func (p *filesystemProvider) Exists(path string) (bool, error) {
+	_, err := os.Stat(filepath.Join(p.root, path))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "could not stat file")
+	}
+	return true, nil
+}
+
+func (p *filesystemProvider) Put(path string, contents io.Reader) error {
+	full := filepath.Join(p.root, path)
+
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return errors.Wrap(err, "could not create directory")
+	}
+
+	f, err := os.Create(full)
+	if err != nil {
+		return errors.Wrap(err, "could not create file")
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, contents)
+	return errors.Wrap(err, "could not write file")
+}
+
+func (p *filesystemProvider) List(prefix string) ([]cache.Object, error) {
+	root := filepath.Join(p.root, prefix)
+
+	var objects []cache.Object
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.root, file)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, cache.Object{Key: rel, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	return objects, errors.Wrap(err, "could not walk directory")
+}
+
+func (p *filesystemProvider) Stat(path string) (cache.Object, error) {
+	info, err := os.Stat(filepath.Join(p.root, path))
+	if err != nil {
+		return cache.Object{}, errors.Wrap(err, "could not stat file")
+	}
+	return cache.Object{Key: path, Size: info.Size(), LastModified: info.ModTime()}, nil
+}
+
+func (p *filesystemProvider) Delete(path string) error {
+	return errors.Wrap(os.Remove(filepath.Join(p.root, path)), "could not delete file")
+}
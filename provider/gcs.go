@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	"github.com/meltwater/drone-s3-cache/cache"
+)
+
+// gcsProvider is a cache.Provider backed by Google Cloud Storage.
+type gcsProvider struct {
+	bucket string
+	client *storage.Client
+}
+
+// NewGCS builds a cache.Provider targeting a GCS bucket. credentialsFile may
+// be empty, in which case application-default credentials are used.
+func NewGCS(bucket, credentialsFile string) (cache.Provider, error) {
+	ctx := context.Background()
+
+	var opts []option.ClientOption
+	if credentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsFile))
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create gcs client")
+	}
+
+	return &gcsProvider{bucket: bucket, client: client}, nil
+}
+
+func (p *gcsProvider) Get(path string) (io.ReadCloser, error) {
+	rc, err := p.client.Bucket(p.bucket).Object(path).NewReader(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get object")
+	}
+	return rc, nil
+}
+
+func (p *gcsProvider) Exists(path string) (bool, error) {
+	_, err := p.client.Bucket(p.bucket).Object(path).Attrs(context.Background())
+	if err == storage.ErrObjectNotExist {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "could not stat object")
+	}
+	return true, nil
+}
+
+func (p *gcsProvider) Put(path string, contents io.Reader) error {
+	w := p.client.Bucket(p.bucket).Object(path).NewWriter(context.Background())
+	if _, err := io.Copy(w, contents); err != nil {
+		w.Close()
+		return errors.Wrap(err, "could not upload object")
+	}
+	return errors.Wrap(w.Close(), "could not finalize object")
+}
+
+func (p *gcsProvider) List(prefix string) ([]cache.Object, error) {
+	var objects []cache.Object
+
+	it := p.client.Bucket(p.bucket).Objects(context.Background(), &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "could not list objects")
+		}
+		objects = append(objects, cache.Object{Key: attrs.Name, Size: attrs.Size, LastModified: attrs.Updated})
+	}
+	return objects, nil
+}
+
+func (p *gcsProvider) Stat(path string) (cache.Object, error) {
+	attrs, err := p.client.Bucket(p.bucket).Object(path).Attrs(context.Background())
+	if err != nil {
+		return cache.Object{}, errors.Wrap(err, "could not stat object")
+	}
+	return cache.Object{Key: path, Size: attrs.Size, LastModified: attrs.Updated}, nil
+}
+
+func (p *gcsProvider) Delete(path string) error {
+	err := p.client.Bucket(p.bucket).Object(path).Delete(context.Background())
+	return errors.Wrap(err, "could not delete object")
+}
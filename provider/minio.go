@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"io"
+
+	"github.com/minio/minio-go/v6"
+	"github.com/pkg/errors"
+
+	"github.com/meltwater/drone-s3-cache/cache"
+)
+
+// minioProvider is a cache.Provider backed by a native MinIO client, kept
+// distinct from the aws-sdk-go S3 path since it speaks the MinIO protocol
+// extensions directly rather than the plain S3 API.
+type minioProvider struct {
+	bucket string
+	client *minio.Client
+}
+
+// NewMinio builds a cache.Provider targeting a MinIO (or other
+// minio-go-compatible) endpoint.
+func NewMinio(endpoint, accessKey, secretKey, bucket string, useSSL bool) (cache.Provider, error) {
+	client, err := minio.New(endpoint, accessKey, secretKey, useSSL)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create minio client")
+	}
+
+	return &minioProvider{bucket: bucket, client: client}, nil
+}
+
+func (p *minioProvider) Get(path string) (io.ReadCloser, error) {
+	obj, err := p.client.GetObject(p.bucket, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get object")
+	}
+	return obj, nil
+}
+
+func (p *minioProvider) Exists(path string) (bool, error) {
+	_, err := p.client.StatObject(p.bucket, path, minio.StatObjectOptions{})
+	if err != nil {
+		if errResp := minio.ToErrorResponse(err); errResp.Code == "NoSuchKey" {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "could not stat object")
+	}
+	return true, nil
+}
+
+func (p *minioProvider) Put(path string, contents io.Reader) error {
+	_, err := p.client.PutObject(p.bucket, path, contents, -1, minio.PutObjectOptions{})
+	return errors.Wrap(err, "could not upload object")
+}
+
+func (p *minioProvider) List(prefix string) ([]cache.Object, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	var objects []cache.Object
+	for info := range p.client.ListObjectsV2(p.bucket, prefix, true, doneCh) {
+		if info.Err != nil {
+			return nil, errors.Wrap(info.Err, "could not list objects")
+		}
+		objects = append(objects, cache.Object{Key: info.Key, Size: info.Size, LastModified: info.LastModified})
+	}
+	return objects, nil
+}
+
+func (p *minioProvider) Stat(path string) (cache.Object, error) {
+	info, err := p.client.StatObject(p.bucket, path, minio.StatObjectOptions{})
+	if err != nil {
+		return cache.Object{}, errors.Wrap(err, "could not stat object")
+	}
+	return cache.Object{Key: path, Size: info.Size, LastModified: info.LastModified}, nil
+}
+
+func (p *minioProvider) Delete(path string) error {
+	return errors.Wrap(p.client.RemoveObject(p.bucket, path), "could not delete object")
+}
@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"io"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+
+	"github.com/meltwater/drone-s3-cache/cache"
+	"github.com/meltwater/drone-s3-cache/retry"
+)
+
+// retryingProvider decorates a cache.Provider, retrying transient failures
+// (throttling, 5xx responses, timeouts, connection resets) with
+// exponential backoff instead of failing the whole rebuild/restore.
+type retryingProvider struct {
+	cache.Provider
+	cfg retry.Config
+}
+
+// WithRetry wraps p so transient per-object errors are retried
+// automatically.
+func WithRetry(p cache.Provider, cfg retry.Config) cache.Provider {
+	return &retryingProvider{Provider: p, cfg: cfg}
+}
+
+func (p *retryingProvider) Get(path string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := retry.Do(p.cfg, isTransient, func() error {
+		var err error
+		rc, err = p.Provider.Get(path)
+		return err
+	})
+	return rc, err
+}
+
+// Put retries only when contents is seekable, since a partially-read
+// stream (e.g. a tar pipe) can't be safely replayed.
+func (p *retryingProvider) Put(path string, contents io.Reader) error {
+	seeker, ok := contents.(io.ReadSeeker)
+	if !ok {
+		return p.Provider.Put(path, contents)
+	}
+
+	return retry.Do(p.cfg, isTransient, func() error {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return p.Provider.Put(path, seeker)
+	})
+}
+
+func (p *retryingProvider) Exists(path string) (bool, error) {
+	var exists bool
+	err := retry.Do(p.cfg, isTransient, func() error {
+		var err error
+		exists, err = p.Provider.Exists(path)
+		return err
+	})
+	return exists, err
+}
+
+func (p *retryingProvider) Stat(path string) (cache.Object, error) {
+	var obj cache.Object
+	err := retry.Do(p.cfg, isTransient, func() error {
+		var err error
+		obj, err = p.Provider.Stat(path)
+		return err
+	})
+	return obj, err
+}
+
+func (p *retryingProvider) Delete(path string) error {
+	return retry.Do(p.cfg, isTransient, func() error {
+		return p.Provider.Delete(path)
+	})
+}
+
+func (p *retryingProvider) List(prefix string) ([]cache.Object, error) {
+	var objects []cache.Object
+	err := retry.Do(p.cfg, isTransient, func() error {
+		var err error
+		objects, err = p.Provider.List(prefix)
+		return err
+	})
+	return objects, err
+}
+
+// isTransient reports whether err looks like a retryable transport-level
+// failure rather than a permanent one (bad credentials, missing bucket,
+// access denied, ...). Every Provider wraps the errors it returns with
+// errors.Wrap, so the underlying awserr.Error/net.Error is checked via
+// errors.Cause rather than a direct type assertion against err itself.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	cause := errors.Cause(err)
+
+	if aerr, ok := cause.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "RequestTimeout", "RequestTimeoutException", "Throttling", "ThrottlingException",
+			"ProvisionedThroughputExceededException", "TooManyRequestsException",
+			"InternalError", "ServiceUnavailable", "SlowDown":
+			return true
+		}
+	}
+
+	if netErr, ok := cause.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "EOF")
+}
@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"net"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+)
+
+type fakeTimeoutErr struct{}
+
+func (fakeTimeoutErr) Error() string   { return "fake timeout" }
+func (fakeTimeoutErr) Timeout() bool   { return true }
+func (fakeTimeoutErr) Temporary() bool { return true }
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "wrapped throttling aws error is transient",
+			err:  errors.Wrap(awserr.New("ThrottlingException", "slow down", nil), "could not put object"),
+			want: true,
+		},
+		{
+			name: "wrapped access denied aws error is not transient",
+			err:  errors.Wrap(awserr.New("AccessDenied", "nope", nil), "could not put object"),
+			want: false,
+		},
+		{
+			name: "wrapped net timeout is transient",
+			err:  errors.Wrap(fakeTimeoutErr{}, "could not get object"),
+			want: true,
+		},
+		{
+			name: "wrapped connection reset message is transient",
+			err:  errors.Wrap(errors.New("read: connection reset by peer"), "could not list objects"),
+			want: true,
+		},
+		{
+			name: "wrapped permanent error is not transient",
+			err:  errors.Wrap(errors.New("no such bucket"), "could not stat object"),
+			want: false,
+		},
+		{
+			name: "nil error is not transient",
+			err:  nil,
+			want: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isTransient(tc.err); got != tc.want {
+				t.Errorf("isTransient(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+var _ net.Error = fakeTimeoutErr{}
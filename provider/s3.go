@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/pkg/errors"
+
+	"github.com/meltwater/drone-s3-cache/cache"
+)
+
+// s3Provider is a cache.Provider backed by an S3-compatible object store.
+type s3Provider struct {
+	bucket     string
+	acl        string
+	encryption string
+	client     *s3.S3
+	uploader   *s3manager.Uploader
+	downloader *s3manager.Downloader
+}
+
+// UploadConfig tunes the multipart uploader used for large caches. Zero
+// values fall back to the s3manager defaults.
+type UploadConfig struct {
+	// PartSize is the size, in bytes, of each part in a multipart upload.
+	PartSize int64
+	// Concurrency is the number of parts uploaded in parallel.
+	Concurrency int
+}
+
+// NewS3 builds a cache.Provider targeting an S3-compatible bucket.
+func NewS3(bucket, acl, encryption string, conf *aws.Config, upload UploadConfig) cache.Provider {
+	sess := session.Must(session.NewSession(conf))
+	uploader := s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
+		if upload.PartSize > 0 {
+			u.PartSize = upload.PartSize
+		}
+		if upload.Concurrency > 0 {
+			u.Concurrency = upload.Concurrency
+		}
+	})
+
+	return &s3Provider{
+		bucket:     bucket,
+		acl:        acl,
+		encryption: encryption,
+		client:     s3.New(sess),
+		uploader:   uploader,
+		downloader: s3manager.NewDownloader(sess),
+	}
+}
+
+func (p *s3Provider) Get(path string) (io.ReadCloser, error) {
+	out, err := p.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get object")
+	}
+	return out.Body, nil
+}
+
+func (p *s3Provider) Exists(path string) (bool, error) {
+	_, err := p.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotFound" {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "could not head object")
+	}
+	return true, nil
+}
+
+func (p *s3Provider) Put(path string, contents io.Reader) error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(path),
+		Body:   contents,
+		ACL:    aws.String(p.acl),
+	}
+	if p.encryption != "" {
+		input.ServerSideEncryption = aws.String(p.encryption)
+	}
+
+	_, err := p.uploader.Upload(input)
+	return errors.Wrap(err, "could not upload object")
+}
+
+func (p *s3Provider) List(prefix string) ([]cache.Object, error) {
+	var objects []cache.Object
+
+	err := p.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(p.bucket),
+		Prefix: aws.String(prefix),
+	}, func(out *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range out.Contents {
+			objects = append(objects, cache.Object{
+				Key:          aws.StringValue(obj.Key),
+				Size:         aws.Int64Value(obj.Size),
+				LastModified: aws.TimeValue(obj.LastModified),
+			})
+		}
+		return true
+	})
+	return objects, errors.Wrap(err, "could not list objects")
+}
+
+func (p *s3Provider) Stat(path string) (cache.Object, error) {
+	out, err := p.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		return cache.Object{}, errors.Wrap(err, "could not head object")
+	}
+
+	return cache.Object{
+		Key:          path,
+		Size:         aws.Int64Value(out.ContentLength),
+		LastModified: aws.TimeValue(out.LastModified),
+	}, nil
+}
+
+func (p *s3Provider) Delete(path string) error {
+	_, err := p.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(p.bucket),
+		Key:    aws.String(path),
+	})
+	return errors.Wrap(err, "could not delete object")
+}
@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/meltwater/drone-s3-cache/cache"
+)
+
+// sftpProvider is a cache.Provider backed by a remote directory reached
+// over SFTP.
+type sftpProvider struct {
+	root   string
+	client *sftp.Client
+}
+
+// NewSFTP builds a cache.Provider targeting a directory on a remote host,
+// authenticating with the given SSH client config.
+func NewSFTP(addr, root string, config *ssh.ClientConfig) (cache.Provider, error) {
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not dial sftp host")
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create sftp client")
+	}
+
+	return &sftpProvider{root: root, client: client}, nil
+}
+
+func (p *sftpProvider) Get(path string) (io.ReadCloser, error) {
+	f, err := p.client.Open(filepath.Join(p.root, path))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open remote file")
+	}
+	return f, nil
+}
+
+func (p *sftpProvider) Exists(path string) (bool, error) {
+	_, err := p.client.Stat(filepath.Join(p.root, path))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "could not stat remote file")
+	}
+	return true, nil
+}
+
+func (p *sftpProvider) Put(path string, contents io.Reader) error {
+	full := filepath.Join(p.root, path)
+
+	if err := p.client.MkdirAll(filepath.Dir(full)); err != nil {
+		return errors.Wrap(err, "could not create remote directory")
+	}
+
+	f, err := p.client.Create(full)
+	if err != nil {
+		return errors.Wrap(err, "could not create remote file")
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, contents)
+	return errors.Wrap(err, "could not write remote file")
+}
+
+func (p *sftpProvider) List(prefix string) ([]cache.Object, error) {
+	root := filepath.Join(p.root, prefix)
+
+	var objects []cache.Object
+	walker := p.client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, errors.Wrap(err, "could not walk remote directory")
+		}
+		if walker.Stat().IsDir() {
+			continue
+		}
+
+		rel, err := filepath.Rel(p.root, walker.Path())
+		if err != nil {
+			return nil, errors.Wrap(err, "could not resolve relative path")
+		}
+		objects = append(objects, cache.Object{
+			Key:          rel,
+			Size:         walker.Stat().Size(),
+			LastModified: walker.Stat().ModTime(),
+		})
+	}
+	return objects, nil
+}
+
+func (p *sftpProvider) Stat(path string) (cache.Object, error) {
+	info, err := p.client.Stat(filepath.Join(p.root, path))
+	if err != nil {
+		return cache.Object{}, errors.Wrap(err, "could not stat remote file")
+	}
+	return cache.Object{Key: path, Size: info.Size(), LastModified: info.ModTime()}, nil
+}
+
+func (p *sftpProvider) Delete(path string) error {
+	return errors.Wrap(p.client.Remove(filepath.Join(p.root, path)), "could not delete remote file")
+}
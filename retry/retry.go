@@ -0,0 +1,48 @@
+// Package retry implements exponential backoff with jitter for operations
+// that only make sense to repeat on transient failures.
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Config bounds how a Do call retries.
+type Config struct {
+	// MaxRetries is the number of retries attempted after the first try.
+	// Zero falls back to 3.
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry; each subsequent
+	// retry doubles it. Zero falls back to 200ms.
+	BaseDelay time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	}
+	if c.BaseDelay == 0 {
+		c.BaseDelay = 200 * time.Millisecond
+	}
+	return c
+}
+
+// Do calls fn, retrying with exponential backoff and full jitter as long as
+// isTransient(err) holds and the retry budget isn't exhausted.
+func Do(cfg Config, isTransient func(error) bool, fn func() error) error {
+	cfg = cfg.withDefaults()
+
+	var err error
+	for attempt := 0; attempt <= cfg.MaxRetries; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if !isTransient(err) || attempt == cfg.MaxRetries {
+			return err
+		}
+
+		delay := cfg.BaseDelay * time.Duration(uint(1)<<uint(attempt))
+		time.Sleep(time.Duration(rand.Int63n(int64(delay) + 1)))
+	}
+	return err
+}